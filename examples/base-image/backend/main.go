@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func handler(w http.ResponseWriter, r *http.Request) {
@@ -11,9 +16,94 @@ func handler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, env+" backend says hi!")
 }
 
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "OK")
+}
+
+var serviceName = getEnv("SERVICE_NAME", "backend")
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// logJSON writes a single structured log line to stdout.
+func logJSON(level, msg string, fields map[string]interface{}) {
+	entry := map[string]interface{}{
+		"time":    time.Now().UTC().Format(time.RFC3339Nano),
+		"level":   level,
+		"service": serviceName,
+		"msg":     msg,
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	line, _ := json.Marshal(entry)
+	fmt.Println(string(line))
+}
+
+func fatal(err error) {
+	logJSON("error", err.Error(), nil)
+	os.Exit(1)
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs every request except for health probes.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		logJSON("info", "request", map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      rec.status,
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+		})
+	})
+}
+
 func main() {
 	http.HandleFunc("/backend", handler)
-	fmt.Println("Server running...")
+	http.HandleFunc("/healthz", healthHandler)
+	http.HandleFunc("/readyz", healthHandler)
+
+	server := &http.Server{Addr: ":" + getEnv("PORT", "8080"), Handler: logRequests(http.DefaultServeMux)}
+
+	go func() {
+		logJSON("info", "Server running", map[string]interface{}{"addr": server.Addr})
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal(err)
+		}
+	}()
+
+	// Wait for the termination signal sent by Kubernetes during rollouts, then stop accepting
+	// new connections and let in-flight requests complete.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	logJSON("info", "Shutting down", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	http.ListenAndServe(":8080", nil)
+	if err := server.Shutdown(ctx); err != nil {
+		fatal(err)
+	}
 }
@@ -1,17 +1,182 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// The shared config is copied into the build context by the shared-config build dependency.
+const configPath = "config/config.env"
+
+// config holds the latest successfully loaded config as a map[string]string, so that
+// handlers never observe a partially reloaded config.
+var config atomic.Value
+
+func loadConfig(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid line in %s: %q", path, line)
+		}
+		values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return values, nil
+}
+
+// watchConfig polls the config file and reloads it whenever its modification time changes.
+// If a reload fails, the previously loaded config stays in effect.
+func watchConfig(path string, interval time.Duration) {
+	var lastModified time.Time
+
+	for {
+		info, err := os.Stat(path)
+		if err != nil {
+			logJSON("warn", "Unable to read config", map[string]interface{}{"path": path, "error": err.Error()})
+		} else if !info.ModTime().Equal(lastModified) {
+			values, err := loadConfig(path)
+			if err != nil {
+				logJSON("warn", "Unable to load config", map[string]interface{}{"path": path, "error": err.Error()})
+			} else {
+				config.Store(values)
+				lastModified = info.ModTime()
+				logJSON("info", "Loaded config", map[string]interface{}{"path": path})
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+func currentConfig() map[string]string {
+	values, _ := config.Load().(map[string]string)
+	return values
+}
+
 func handler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "Hello from Go!")
 }
 
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "Config says: %s", currentConfig()["MESSAGE"])
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "OK")
+}
+
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	if currentConfig() == nil {
+		http.Error(w, "Config not loaded", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprint(w, "OK")
+}
+
+var serviceName = getEnv("SERVICE_NAME", "backend")
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// logJSON writes a single structured log line to stdout.
+func logJSON(level, msg string, fields map[string]interface{}) {
+	entry := map[string]interface{}{
+		"time":    time.Now().UTC().Format(time.RFC3339Nano),
+		"level":   level,
+		"service": serviceName,
+		"msg":     msg,
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	line, _ := json.Marshal(entry)
+	fmt.Println(string(line))
+}
+
+func fatal(err error) {
+	logJSON("error", err.Error(), nil)
+	os.Exit(1)
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs every request except for health probes.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		logJSON("info", "request", map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      rec.status,
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+		})
+	})
+}
+
 func main() {
 	http.HandleFunc("/hello-backend", handler)
-	fmt.Println("Server running...")
+	http.HandleFunc("/config", configHandler)
+	http.HandleFunc("/healthz", healthHandler)
+	http.HandleFunc("/readyz", readyHandler)
+
+	go watchConfig(configPath, 2*time.Second)
+
+	server := &http.Server{Addr: ":" + getEnv("PORT", "8080"), Handler: logRequests(http.DefaultServeMux)}
+
+	go func() {
+		logJSON("info", "Server running", map[string]interface{}{"addr": server.Addr})
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal(err)
+		}
+	}()
+
+	// Wait for the termination signal sent by Kubernetes during rollouts, then stop accepting
+	// new connections and let in-flight requests complete.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	logJSON("info", "Shutting down", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	http.ListenAndServe(":8080", nil)
+	if err := server.Shutdown(ctx); err != nil {
+		fatal(err)
+	}
 }
@@ -1,17 +1,596 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func handler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "Hello from Go!")
 }
 
+// The frontend is deployed after the backend, so calls to it are retried a few times with a
+// short backoff, and every attempt gets its own timeout so a hanging request can't block the rest.
+const (
+	upstreamAttempts = 3
+	upstreamTimeout  = 2 * time.Second
+	upstreamBackoff  = 500 * time.Millisecond
+)
+
+var frontendURL = getEnv("FRONTEND_URL", "http://frontend:8080/hello-frontend")
+
+// fetchUpstream makes a single request to url. The returned bool is true if the request may be retried.
+func fetchUpstream(ctx context.Context, url string) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", false, err
+	}
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", true, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", true, err
+	}
+	if res.StatusCode >= 500 {
+		return "", true, fmt.Errorf("received %s", res.Status)
+	}
+	if res.StatusCode >= 400 {
+		return "", false, fmt.Errorf("received %s", res.Status)
+	}
+	return string(body), false, nil
+}
+
+func callUpstream(ctx context.Context, url string) (string, error) {
+	var err error
+
+	for attempt := 1; attempt <= upstreamAttempts; attempt++ {
+		var body string
+		var retry bool
+
+		body, retry, err = fetchUpstream(ctx, url)
+		if err == nil {
+			return body, nil
+		}
+
+		logJSON("warn", "Upstream request failed", map[string]interface{}{
+			"url":     url,
+			"attempt": attempt,
+			"error":   err.Error(),
+		})
+		if !retry || attempt == upstreamAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Duration(attempt) * upstreamBackoff):
+		}
+	}
+
+	return "", err
+}
+
+func callFrontendHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	message, err := callUpstream(r.Context(), frontendURL)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":   err.Error(),
+			"message": "Unable to reach service at " + frontendURL,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Frontend says: '" + message + "'",
+	})
+}
+
+// The /inject endpoints misbehave on purpose, so that tests can exercise timeouts, retries and
+// failure reporting against a real service.
+const maxInjectedLatency = 60 * time.Second
+
+func injectLatencyHandler(w http.ResponseWriter, r *http.Request) {
+	ms, err := strconv.Atoi(r.URL.Query().Get("ms"))
+	if err != nil || ms < 0 {
+		http.Error(w, "The ms parameter must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+	delay := time.Duration(ms) * time.Millisecond
+	if delay > maxInjectedLatency {
+		http.Error(w, fmt.Sprintf("The ms parameter must not exceed %d", maxInjectedLatency/time.Millisecond), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case <-time.After(delay):
+		fmt.Fprintf(w, "Responded after %dms", ms)
+	case <-r.Context().Done():
+	}
+}
+
+func injectErrorHandler(w http.ResponseWriter, r *http.Request) {
+	rate, err := strconv.ParseFloat(r.URL.Query().Get("rate"), 64)
+	if err != nil || rate < 0 || rate > 1 {
+		http.Error(w, "The rate parameter must be a number between 0 and 1", http.StatusBadRequest)
+		return
+	}
+
+	if rand.Float64() < rate {
+		http.Error(w, "Injected error", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(w, "OK")
+}
+
+// version is set at build time from the GARDEN_MODULE_VERSION build argument (see the Dockerfile).
+var version string
+
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	v := version
+	if v == "" {
+		v = "unknown"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"version":   v,
+		"goVersion": runtime.Version(),
+	})
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "OK")
+}
+
+// The WebSocket endpoint is implemented on top of the standard library (RFC 6455), so that the
+// example doesn't need any dependencies.
+const (
+	websocketGUID       = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	maxWebsocketPayload = 1 << 20
+
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+
+	closeProtocolError = 1002
+	closeMessageTooBig = 1009
+)
+
+// closeError is returned by readFrame when the client violates the protocol. The connection is closed with its code.
+type closeError struct {
+	code   uint16
+	reason string
+}
+
+func (e *closeError) Error() string {
+	return e.reason
+}
+
+func headerContains(h http.Header, key, value string) bool {
+	for _, v := range strings.Split(h.Get(key), ",") {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// websocketHandler upgrades the connection and echoes back every message it receives.
+func websocketHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "Expected a WebSocket upgrade request", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSockets are not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	accept := base64.StdEncoding.EncodeToString(hash[:])
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", accept)
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	for {
+		fin, opcode, payload, err := readFrame(rw.Reader)
+		if cerr, ok := err.(*closeError); ok {
+			closePayload := make([]byte, 2, 2+len(cerr.reason))
+			binary.BigEndian.PutUint16(closePayload, cerr.code)
+			writeFrame(rw.Writer, true, opClose, append(closePayload, cerr.reason...))
+			rw.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		switch opcode {
+		case opClose:
+			writeFrame(rw.Writer, true, opClose, payload)
+			rw.Flush()
+			return
+		case opPing:
+			err = writeFrame(rw.Writer, true, opPong, payload)
+		case opPong:
+			continue
+		default:
+			// Echo data and continuation frames as-is, which also preserves fragmented messages.
+			err = writeFrame(rw.Writer, fin, opcode, payload)
+		}
+		if err == nil {
+			err = rw.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func readFrame(r *bufio.Reader) (fin bool, opcode byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	rsv := header[0] & 0x70
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err = io.ReadFull(r, ext); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err = io.ReadFull(r, ext); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+
+	// No extensions are negotiated, so the reserved bits must not be set.
+	if rsv != 0 {
+		err = &closeError{closeProtocolError, "reserved bits set"}
+		return
+	}
+	switch opcode {
+	case opContinuation, opText, opBinary:
+	case opClose, opPing, opPong:
+		// Control frames can't be fragmented and carry at most 125 bytes.
+		if !fin || length > 125 {
+			err = &closeError{closeProtocolError, "invalid control frame"}
+			return
+		}
+	default:
+		err = &closeError{closeProtocolError, "unknown opcode"}
+		return
+	}
+	// Clients must mask every frame they send.
+	if !masked {
+		err = &closeError{closeProtocolError, "received unmasked frame from client"}
+		return
+	}
+	if length > maxWebsocketPayload {
+		err = &closeError{closeMessageTooBig, "frame payload too large"}
+		return
+	}
+
+	mask := make([]byte, 4)
+	if _, err = io.ReadFull(r, mask); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+func writeFrame(w *bufio.Writer, fin bool, opcode byte, payload []byte) error {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+
+	header := []byte{first}
+	length := len(payload)
+	switch {
+	case length < 126:
+		header = append(header, byte(length))
+	case length <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// Request metrics are exposed in the Prometheus text format, so that they can be scraped without
+// pulling in the Prometheus client library.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	path string
+	code int
+}
+
+type histogram struct {
+	buckets []int
+	count   int
+	sum     float64
+}
+
+type requestMetrics struct {
+	mu        sync.Mutex
+	requests  map[requestKey]int
+	durations map[string]*histogram
+}
+
+var metrics = &requestMetrics{
+	requests:  map[requestKey]int{},
+	durations: map[string]*histogram{},
+}
+
+func (m *requestMetrics) observe(path string, code int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{path, code}]++
+
+	h, ok := m.durations[path]
+	if !ok {
+		h = &histogram{buckets: make([]int, len(durationBuckets))}
+		m.durations[path] = h
+	}
+	seconds := duration.Seconds()
+	for i, le := range durationBuckets {
+		if seconds <= le {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// snapshot copies the current metrics, so that they can be written out without holding the lock.
+func (m *requestMetrics) snapshot() (map[requestKey]int, map[string]histogram) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	requests := make(map[requestKey]int, len(m.requests))
+	for key, count := range m.requests {
+		requests[key] = count
+	}
+
+	durations := make(map[string]histogram, len(m.durations))
+	for path, h := range m.durations {
+		durations[path] = histogram{
+			buckets: append([]int(nil), h.buckets...),
+			count:   h.count,
+			sum:     h.sum,
+		}
+	}
+
+	return requests, durations
+}
+
+func (m *requestMetrics) handler(w http.ResponseWriter, r *http.Request) {
+	requests, durations := m.snapshot()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	keys := make([]requestKey, 0, len(requests))
+	for key := range requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+		return keys[i].code < keys[j].code
+	})
+
+	fmt.Fprintln(w, "# HELP http_requests_total Total number of HTTP requests handled.")
+	fmt.Fprintln(w, "# TYPE http_requests_total counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "http_requests_total{path=%q,code=\"%d\"} %d\n", key.path, key.code, requests[key])
+	}
+
+	paths := make([]string, 0, len(durations))
+	for path := range durations {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	fmt.Fprintln(w, "# HELP http_request_duration_seconds HTTP request latencies in seconds.")
+	fmt.Fprintln(w, "# TYPE http_request_duration_seconds histogram")
+	for _, path := range paths {
+		h := durations[path]
+		for i, le := range durationBuckets {
+			fmt.Fprintf(w, "http_request_duration_seconds_bucket{path=%q,le=\"%g\"} %d\n", path, le, h.buckets[i])
+		}
+		fmt.Fprintf(w, "http_request_duration_seconds_bucket{path=%q,le=\"+Inf\"} %d\n", path, h.count)
+		fmt.Fprintf(w, "http_request_duration_seconds_sum{path=%q} %g\n", path, h.sum)
+		fmt.Fprintf(w, "http_request_duration_seconds_count{path=%q} %d\n", path, h.count)
+	}
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack lets handlers wrapped in a statusRecorder take over the connection, e.g. for WebSockets.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// handle registers h for path and records request metrics for it.
+func handle(path string, h http.HandlerFunc) {
+	http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h(rec, r)
+		metrics.observe(path, rec.status, time.Since(start))
+	})
+}
+
+var serviceName = getEnv("SERVICE_NAME", "backend")
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// logJSON writes a single structured log line to stdout.
+func logJSON(level, msg string, fields map[string]interface{}) {
+	entry := map[string]interface{}{
+		"time":    time.Now().UTC().Format(time.RFC3339Nano),
+		"level":   level,
+		"service": serviceName,
+		"msg":     msg,
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	line, _ := json.Marshal(entry)
+	fmt.Println(string(line))
+}
+
+func fatal(err error) {
+	logJSON("error", err.Error(), nil)
+	os.Exit(1)
+}
+
+// logRequests logs every request except for health probes.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		logJSON("info", "request", map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      rec.status,
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+		})
+	})
+}
+
 func main() {
-	http.HandleFunc("/hello-backend", handler)
-	fmt.Println("Server running...")
+	handle("/hello-backend", handler)
+	http.HandleFunc("/healthz", healthHandler)
+	http.HandleFunc("/readyz", healthHandler)
+	http.HandleFunc("/metrics", metrics.handler)
+	http.HandleFunc("/ws", websocketHandler)
+	handle("/version", versionHandler)
+	handle("/call-frontend", callFrontendHandler)
+	handle("/inject/latency", injectLatencyHandler)
+	handle("/inject/error", injectErrorHandler)
+
+	rand.Seed(time.Now().UnixNano())
+
+	server := &http.Server{Addr: ":" + getEnv("PORT", "8080"), Handler: logRequests(http.DefaultServeMux)}
+
+	go func() {
+		logJSON("info", "Server running", map[string]interface{}{"addr": server.Addr})
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal(err)
+		}
+	}()
+
+	// Wait for the termination signal sent by Kubernetes during rollouts, then stop accepting
+	// new connections and let in-flight requests complete.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	logJSON("info", "Shutting down", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	http.ListenAndServe(":8080", nil)
+	if err := server.Shutdown(ctx); err != nil {
+		fatal(err)
+	}
 }
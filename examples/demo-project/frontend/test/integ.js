@@ -1,3 +1,6 @@
+const assert = require("assert")
+const crypto = require("crypto")
+const http = require("http")
 const supertest = require("supertest")
 const { app } = require("../app")
 
@@ -15,3 +18,46 @@ describe('GET /call-backend', () => {
   })
 })
 
+
+describe('WebSocket /ws on the backend', () => {
+  it('should echo a text message', (done) => {
+    const req = http.request({
+      host: "backend",
+      path: "/ws",
+      headers: {
+        "Connection": "Upgrade",
+        "Upgrade": "websocket",
+        "Sec-WebSocket-Key": crypto.randomBytes(16).toString("base64"),
+        "Sec-WebSocket-Version": "13",
+      },
+    })
+
+    req.on("upgrade", (res, socket) => {
+      const message = Buffer.from("Hello over WebSocket")
+      const mask = crypto.randomBytes(4)
+      const masked = Buffer.from(message.map((b, i) => b ^ mask[i % 4]))
+      // FIN + text opcode, then the masked payload length (messages under 126 bytes fit in one byte)
+      socket.write(Buffer.concat([Buffer.from([0x81, 0x80 | message.length]), mask, masked]))
+
+      let received = Buffer.alloc(0)
+      socket.on("data", (data) => {
+        received = Buffer.concat([received, data])
+        if (received.length < 2 + message.length) {
+          return
+        }
+        socket.destroy()
+        try {
+          assert.strictEqual(received[0], 0x81)
+          assert.strictEqual(received[1], message.length)
+          assert.strictEqual(received.slice(2).toString(), message.toString())
+          done()
+        } catch (err) {
+          done(err)
+        }
+      })
+    })
+    req.on("response", (res) => done(new Error(`Expected a WebSocket upgrade, got status ${res.statusCode}`)))
+    req.on("error", done)
+    req.end()
+  })
+})
@@ -0,0 +1,8 @@
+module github.com/garden-io/garden/examples/grpc/greeter
+
+go 1.16
+
+require (
+	google.golang.org/grpc v1.38.0
+	google.golang.org/protobuf v1.26.0
+)
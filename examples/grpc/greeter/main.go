@@ -0,0 +1,165 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative greeterpb/greeter.proto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/garden-io/garden/examples/grpc/greeter/greeterpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+var serviceName = getEnv("SERVICE_NAME", "greeter")
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// logJSON writes a single structured log line to stdout.
+func logJSON(level, msg string, fields map[string]interface{}) {
+	entry := map[string]interface{}{
+		"time":    time.Now().UTC().Format(time.RFC3339Nano),
+		"level":   level,
+		"service": serviceName,
+		"msg":     msg,
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	line, _ := json.Marshal(entry)
+	fmt.Println(string(line))
+}
+
+func fatal(err error) {
+	logJSON("error", err.Error(), nil)
+	os.Exit(1)
+}
+
+type greeterServer struct {
+	greeterpb.UnimplementedGreeterServer
+}
+
+func (s *greeterServer) SayHello(ctx context.Context, req *greeterpb.HelloRequest) (*greeterpb.HelloReply, error) {
+	logJSON("info", "SayHello", map[string]interface{}{"name": req.GetName()})
+	return &greeterpb.HelloReply{Message: "Hello " + req.GetName() + "!"}, nil
+}
+
+func dial(ctx context.Context) (*grpc.ClientConn, error) {
+	addr := getEnv("GREETER_ADDR", "localhost:"+getEnv("PORT", "50051"))
+	return grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+}
+
+// checkHealth queries the standard gRPC health service, the same way grpc-health-probe does.
+// It's used as the container health check.
+func checkHealth() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	conn, err := dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	res, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		return err
+	}
+	if res.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+		return fmt.Errorf("service is %s", res.GetStatus())
+	}
+	return nil
+}
+
+// checkGreeting calls the Greeter service at GREETER_ADDR and verifies the reply. It's used by the
+// integ test.
+func checkGreeting() error {
+	if err := checkHealth(); err != nil {
+		return fmt.Errorf("health check failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	res, err := greeterpb.NewGreeterClient(conn).SayHello(ctx, &greeterpb.HelloRequest{Name: "Garden"})
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(res.GetMessage(), "Garden") {
+		return fmt.Errorf("unexpected reply: %q", res.GetMessage())
+	}
+
+	logJSON("info", "Greeter replied", map[string]interface{}{"message": res.GetMessage()})
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "health":
+			err = checkHealth()
+		case "check":
+			err = checkGreeting()
+		default:
+			err = fmt.Errorf("unknown command: %s", os.Args[1])
+		}
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	lis, err := net.Listen("tcp", ":"+getEnv("PORT", "50051"))
+	if err != nil {
+		fatal(err)
+	}
+
+	server := grpc.NewServer()
+	greeterpb.RegisterGreeterServer(server, &greeterServer{})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("greeter.Greeter", grpc_health_v1.HealthCheckResponse_SERVING)
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+
+	// Reflection lets tools like grpcurl discover the services without the .proto files.
+	reflection.Register(server)
+
+	go func() {
+		logJSON("info", "Server running", map[string]interface{}{"addr": lis.Addr().String()})
+		if err := server.Serve(lis); err != nil {
+			fatal(err)
+		}
+	}()
+
+	// Wait for the termination signal sent by Kubernetes during rollouts, report as not serving
+	// and let in-flight calls complete.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	logJSON("info", "Shutting down", nil)
+	healthServer.Shutdown()
+	server.GracefulStop()
+}
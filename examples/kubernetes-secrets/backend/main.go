@@ -1,18 +1,156 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// secretValue holds the latest value read from SECRET_FILE, if set.
+var secretValue atomic.Value
+
+// watchSecretFile polls a mounted Secret key and picks up new values when the Secret is rotated.
+// Kubernetes updates mounted Secrets in place (unlike environment variables, which are only read
+// when the container starts), so this lets the service use rotated credentials without a restart.
+func watchSecretFile(path string, interval time.Duration) {
+	var current string
+
+	for {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			logJSON("warn", "Unable to read secret file", map[string]interface{}{"path": path, "error": err.Error()})
+		} else if value := strings.TrimSpace(string(data)); value != current {
+			secretValue.Store(value)
+			if current == "" {
+				logJSON("info", "Loaded secret", map[string]interface{}{"path": path})
+			} else {
+				logJSON("info", "Secret rotated", map[string]interface{}{"path": path})
+			}
+			current = value
+		}
+		time.Sleep(interval)
+	}
+}
+
+func currentSecret() string {
+	if value, ok := secretValue.Load().(string); ok && value != "" {
+		return value
+	}
+	return os.Getenv("SECRET_VAR")
+}
+
 func handler(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, os.Getenv("SECRET_VAR"))
+	fmt.Fprint(w, currentSecret())
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "OK")
+}
+
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	if currentSecret() == "" {
+		http.Error(w, "Neither SECRET_FILE nor SECRET_VAR provide a secret", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprint(w, "OK")
+}
+
+var serviceName = getEnv("SERVICE_NAME", "backend")
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// logJSON writes a single structured log line to stdout.
+func logJSON(level, msg string, fields map[string]interface{}) {
+	entry := map[string]interface{}{
+		"time":    time.Now().UTC().Format(time.RFC3339Nano),
+		"level":   level,
+		"service": serviceName,
+		"msg":     msg,
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	line, _ := json.Marshal(entry)
+	fmt.Println(string(line))
+}
+
+func fatal(err error) {
+	logJSON("error", err.Error(), nil)
+	os.Exit(1)
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs every request except for health probes.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		logJSON("info", "request", map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      rec.status,
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+		})
+	})
 }
 
 func main() {
 	http.HandleFunc("/hello-backend", handler)
-	fmt.Println("Server running...")
+	http.HandleFunc("/healthz", healthHandler)
+	http.HandleFunc("/readyz", readyHandler)
+
+	if path := os.Getenv("SECRET_FILE"); path != "" {
+		go watchSecretFile(path, 5*time.Second)
+	}
+
+	server := &http.Server{Addr: ":" + getEnv("PORT", "8080"), Handler: logRequests(http.DefaultServeMux)}
+
+	go func() {
+		logJSON("info", "Server running", map[string]interface{}{"addr": server.Addr})
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal(err)
+		}
+	}()
+
+	// Wait for the termination signal sent by Kubernetes during rollouts, then stop accepting
+	// new connections and let in-flight requests complete.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	logJSON("info", "Shutting down", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	http.ListenAndServe(":8080", nil)
+	if err := server.Shutdown(ctx); err != nil {
+		fatal(err)
+	}
 }
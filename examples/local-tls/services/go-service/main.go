@@ -1,17 +1,148 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func handler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "Hello from Go!")
 }
 
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "OK")
+}
+
+// loadCertificate returns the configured TLS certificate, or nil if none is configured. The certificate
+// and key can either be mounted as files (TLS_CERT_FILE and TLS_KEY_FILE) or passed directly as PEM
+// values (TLS_CERT and TLS_KEY), e.g. from a Secret using a secretRef.
+func loadCertificate() (*tls.Certificate, error) {
+	if certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE"); certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		return &cert, err
+	}
+	if certPEM, keyPEM := os.Getenv("TLS_CERT"), os.Getenv("TLS_KEY"); certPEM != "" || keyPEM != "" {
+		cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+		return &cert, err
+	}
+	return nil, nil
+}
+
+var serviceName = getEnv("SERVICE_NAME", "go-service")
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// logJSON writes a single structured log line to stdout.
+func logJSON(level, msg string, fields map[string]interface{}) {
+	entry := map[string]interface{}{
+		"time":    time.Now().UTC().Format(time.RFC3339Nano),
+		"level":   level,
+		"service": serviceName,
+		"msg":     msg,
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	line, _ := json.Marshal(entry)
+	fmt.Println(string(line))
+}
+
+func fatal(err error) {
+	logJSON("error", err.Error(), nil)
+	os.Exit(1)
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs every request except for health probes.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		logJSON("info", "request", map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      rec.status,
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+		})
+	})
+}
+
 func main() {
 	http.HandleFunc("/", handler)
-	fmt.Println("Server running...")
+	http.HandleFunc("/healthz", healthHandler)
+	http.HandleFunc("/readyz", healthHandler)
+
+	// Terminate TLS in the service itself when a certificate and key are provided. Unless HTTP_FALLBACK
+	// is set to "false", we serve plain HTTP if they're missing or can't be loaded.
+	cert, err := loadCertificate()
+	if err != nil {
+		if os.Getenv("HTTP_FALLBACK") == "false" {
+			fatal(err)
+		}
+		logJSON("warn", "Unable to load TLS certificate, falling back to HTTP", map[string]interface{}{"error": err.Error()})
+		cert = nil
+	} else if cert == nil && os.Getenv("HTTP_FALLBACK") == "false" {
+		fatal(errors.New("a TLS certificate and key must be provided when HTTP_FALLBACK is disabled"))
+	}
+
+	server := &http.Server{Addr: ":" + getEnv("PORT", "80"), Handler: logRequests(http.DefaultServeMux)}
+	if cert != nil {
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{*cert}}
+	}
+
+	go func() {
+		var err error
+		if cert != nil {
+			logJSON("info", "Server running with TLS", map[string]interface{}{"addr": server.Addr})
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			logJSON("info", "Server running", map[string]interface{}{"addr": server.Addr})
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal(err)
+		}
+	}()
+
+	// Wait for the termination signal sent by Kubernetes during rollouts, then stop accepting
+	// new connections and let in-flight requests complete.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	logJSON("info", "Shutting down", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	http.ListenAndServe(":80", nil)
+	if err := server.Shutdown(ctx); err != nil {
+		fatal(err)
+	}
 }
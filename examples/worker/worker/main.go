@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var serviceName = getEnv("SERVICE_NAME", "worker")
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// logJSON writes a single structured log line to stdout.
+func logJSON(level, msg string, fields map[string]interface{}) {
+	entry := map[string]interface{}{
+		"time":    time.Now().UTC().Format(time.RFC3339Nano),
+		"level":   level,
+		"service": serviceName,
+		"msg":     msg,
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	line, _ := json.Marshal(entry)
+	fmt.Println(string(line))
+}
+
+func fatal(err error) {
+	logJSON("error", err.Error(), nil)
+	os.Exit(1)
+}
+
+type job struct {
+	ID      int64  `json:"id"`
+	Payload string `json:"payload"`
+}
+
+var (
+	errQueueClosed = errors.New("queue is closed")
+	errQueueFull   = errors.New("queue is full")
+)
+
+// queue is a bounded in-memory job queue. Once closed, no more jobs are accepted, but the
+// workers keep going until the jobs that are already queued have been processed.
+type queue struct {
+	mu        sync.Mutex
+	closed    bool
+	jobs      chan job
+	nextID    int64
+	processed int64
+}
+
+func newQueue(size int) *queue {
+	return &queue{jobs: make(chan job, size)}
+}
+
+func (q *queue) enqueue(payload string) (job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return job{}, errQueueClosed
+	}
+
+	j := job{ID: q.nextID + 1, Payload: payload}
+	select {
+	case q.jobs <- j:
+		q.nextID++
+		return j, nil
+	default:
+		return job{}, errQueueFull
+	}
+}
+
+func (q *queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+}
+
+func (q *queue) work(id int, jobDuration time.Duration, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for j := range q.jobs {
+		logJSON("info", "Processing job", map[string]interface{}{"worker": id, "job": j.ID, "payload": j.Payload})
+		// Stand-in for real work
+		time.Sleep(jobDuration)
+		atomic.AddInt64(&q.processed, 1)
+		logJSON("info", "Finished job", map[string]interface{}{"worker": id, "job": j.ID})
+	}
+}
+
+func (q *queue) jobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid job: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	j, err := q.enqueue(req.Payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(j)
+}
+
+func (q *queue) statsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{
+		"queued":    int64(len(q.jobs)),
+		"processed": atomic.LoadInt64(&q.processed),
+	})
+}
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "OK")
+}
+
+// seed enqueues count jobs on the worker at WORKER_URL. It's used by the seed-jobs task.
+func seed(count int) error {
+	url := getEnv("WORKER_URL", "http://localhost:8080") + "/jobs"
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	for i := 1; i <= count; i++ {
+		body, _ := json.Marshal(map[string]string{"payload": fmt.Sprintf("seed-%d", i)})
+		res, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusAccepted {
+			return fmt.Errorf("unable to enqueue job %d: received %s", i, res.Status)
+		}
+	}
+
+	logJSON("info", "Enqueued jobs", map[string]interface{}{"count": count, "url": url})
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		count := 10
+		if len(os.Args) > 2 {
+			n, err := strconv.Atoi(os.Args[2])
+			if err != nil || n <= 0 {
+				fatal(fmt.Errorf("invalid job count: %s", os.Args[2]))
+			}
+			count = n
+		}
+		if err := seed(count); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	q := newQueue(getEnvInt("QUEUE_SIZE", 100))
+	jobDuration := time.Duration(getEnvInt("JOB_DURATION_MS", 1000)) * time.Millisecond
+
+	var wg sync.WaitGroup
+	concurrency := getEnvInt("WORKER_CONCURRENCY", 1)
+	for i := 1; i <= concurrency; i++ {
+		wg.Add(1)
+		go q.work(i, jobDuration, &wg)
+	}
+
+	http.HandleFunc("/jobs", q.jobsHandler)
+	http.HandleFunc("/stats", q.statsHandler)
+	http.HandleFunc("/healthz", healthHandler)
+	http.HandleFunc("/readyz", healthHandler)
+
+	server := &http.Server{Addr: ":" + getEnv("PORT", "8080")}
+
+	go func() {
+		logJSON("info", "Worker running", map[string]interface{}{"addr": server.Addr, "concurrency": concurrency})
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	// Stop accepting new jobs, then let the workers drain the queue before exiting. The drain
+	// timeout should be shorter than the pod's termination grace period.
+	logJSON("info", "Shutting down", map[string]interface{}{"queued": len(q.jobs)})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(getEnvInt("DRAIN_TIMEOUT_SECONDS", 25))*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		fatal(err)
+	}
+	q.close()
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		logJSON("info", "Drained queue", map[string]interface{}{"processed": atomic.LoadInt64(&q.processed)})
+	case <-ctx.Done():
+		fatal(fmt.Errorf("timed out draining queue with %d jobs left", len(q.jobs)))
+	}
+}